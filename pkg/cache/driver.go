@@ -0,0 +1,42 @@
+package cache
+
+import (
+	"github.com/cloudreve/Cloudreve/v4/pkg/logging"
+)
+
+// Driver is implemented by every cache backend Cloudreve can use to store
+// transient key/value state - sessions, throttling counters, share tokens,
+// and the like. It lets the rest of the codebase depend on "a cache" instead
+// of a concrete backend, so operators can move from the in-process
+// MemoStore to a shared Redis or Memcached instance without touching any
+// caller.
+type Driver interface {
+	// Set stores value under key. If ttl is greater than zero, the entry
+	// expires after ttl seconds; zero means no expiration.
+	Set(key string, value any, ttl int) error
+	// Get retrieves the value stored under key. ok is false if the key does
+	// not exist or has expired.
+	Get(key string) (any, bool)
+	// Gets retrieves multiple keys, each looked up under prefix+key. It
+	// returns the values that were found and the subset of keys that were
+	// not.
+	Gets(keys []string, prefix string) (map[string]any, []string)
+	// Sets stores multiple values, each under prefix+key.
+	Sets(values map[string]any, prefix string) error
+	// Delete removes the given keys under prefix. If no keys are given, it
+	// removes every entry whose key starts with prefix.
+	Delete(prefix string, keys ...string) error
+	// DeleteAll empties the entire store.
+	DeleteAll() error
+	// List returns the non-expired keys whose key starts with prefix.
+	List(prefix string) ([]string, error)
+	// Iterate calls fn for every non-expired entry whose key starts with
+	// prefix, in no particular order, until fn returns false.
+	Iterate(prefix string, fn func(key string, value any) bool) error
+	// Persist writes the current store content to path.
+	Persist(path string) error
+	// Restore loads store content previously written by Persist from path.
+	Restore(path string) error
+	// GarbageCollect reclaims expired entries.
+	GarbageCollect(l logging.Logger)
+}
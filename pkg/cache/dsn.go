@@ -0,0 +1,34 @@
+package cache
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/cloudreve/Cloudreve/v4/pkg/logging"
+)
+
+// NewFromDSN constructs a Driver from a DSN string, dispatching on its
+// scheme:
+//
+//   - "" or "memory://[path/to/persist/file]" -> in-process MemoStore
+//   - "redis://..." or "rediss://..."         -> RedisStore
+//   - "memcached://host:port[,host:port...]"  -> MemcachedStore
+//
+// This replaces constructing a MemoStore directly as the entry point for
+// config-driven cache selection, e.g. via a CACHE_DSN setting, while
+// existing callers keep working against the Driver interface regardless of
+// which backend was chosen.
+func NewFromDSN(dsn string, l logging.Logger) (Driver, error) {
+	if dsn == "" || strings.HasPrefix(dsn, "memory://") {
+		return NewMemoStore(strings.TrimPrefix(dsn, "memory://"), l), nil
+	}
+
+	switch {
+	case strings.HasPrefix(dsn, "redis://"), strings.HasPrefix(dsn, "rediss://"):
+		return NewRedisStore(dsn)
+	case strings.HasPrefix(dsn, "memcached://"):
+		return NewMemcachedStore(dsn)
+	default:
+		return nil, fmt.Errorf("unsupported cache dsn: %q", dsn)
+	}
+}
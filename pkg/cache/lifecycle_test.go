@@ -0,0 +1,69 @@
+package cache
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+type testShutdownValue struct {
+	N int
+}
+
+func TestMemoStore_Shutdown(t *testing.T) {
+	path := t.TempDir() + "/cache.bin"
+
+	RegisterType("cache.testShutdownValue", testShutdownValue{})
+
+	store := NewMemoStore("", testLogger{}, WithGCInterval(time.Hour))
+	store.persistFile = path
+	store.Set("k", testShutdownValue{N: 42}, 0)
+
+	if err := store.Shutdown(context.Background()); err != nil {
+		t.Fatalf("Shutdown returned error: %s", err)
+	}
+
+	restored := NewMemoStore(path, testLogger{})
+	defer restored.Close()
+
+	value, ok := restored.Get("k")
+	if !ok {
+		t.Fatal("expected key \"k\" to survive Shutdown's persist")
+	}
+	if value.(testShutdownValue).N != 42 {
+		t.Errorf("got %+v, want N=42", value)
+	}
+}
+
+func TestMemoStore_CloseStopsGCLoop(t *testing.T) {
+	store := NewMemoStore("", testLogger{}, WithGCInterval(time.Millisecond))
+	store.Set("k", "v", 0)
+
+	if err := store.Close(); err != nil {
+		t.Fatalf("Close returned error: %s", err)
+	}
+
+	select {
+	case <-store.ctx.Done():
+	default:
+		t.Error("expected Close to cancel the context the GC loop waits on")
+	}
+
+	// A second Close must not panic by double-canceling store.ctx.
+	if err := store.Close(); err != nil {
+		t.Fatalf("second Close returned error: %s", err)
+	}
+}
+
+func TestMemoStore_WithContextStopsGCLoop(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	store := NewMemoStore("", testLogger{}, WithGCInterval(time.Millisecond), WithContext(ctx))
+
+	cancel()
+
+	select {
+	case <-store.ctx.Done():
+	case <-time.After(time.Second):
+		t.Fatal("expected canceling the context passed to WithContext to stop the GC loop")
+	}
+}
@@ -0,0 +1,242 @@
+package cache
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/bradfitz/gomemcache/memcache"
+	"github.com/cloudreve/Cloudreve/v4/pkg/logging"
+)
+
+var _ Driver = (*MemcachedStore)(nil)
+
+// MemcachedStore is a Driver backed by one or more Memcached nodes.
+//
+// It is built on gomemcache, which speaks Memcached's classic text protocol
+// rather than the binary protocol - gomemcache is by far the most mature and
+// widely used Memcached client for Go, and the text protocol is sufficient
+// for the Get/Set/Delete/FlushAll vocabulary this driver needs. TTL is
+// passed through the item's native Expiration field: Memcached's flags are
+// opaque client metadata with no server-enforced expiration semantics, so
+// "flags-based TTL" isn't something either protocol can actually deliver. If
+// binary-protocol-specific behavior is needed later (e.g. CAS, SASL auth
+// extensions), swap this driver for one built on a binary-protocol client
+// instead.
+//
+// Memcached exposes no key-scan operation, so MemcachedStore keeps a local
+// index of every key it has written to support prefix-based Delete, List
+// and Iterate. The index is best-effort: a key evicted by Memcached itself
+// under memory pressure stays in the index until a prefix Delete, List or
+// Iterate reaches it and finds it gone.
+type MemcachedStore struct {
+	client *memcache.Client
+
+	mu    sync.Mutex
+	index map[string]struct{}
+}
+
+// NewMemcachedStore creates a Driver backed by the Memcached node(s)
+// described by dsn, e.g. "memcached://127.0.0.1:11211,127.0.0.1:11212".
+func NewMemcachedStore(dsn string) (*MemcachedStore, error) {
+	addr := strings.TrimPrefix(dsn, "memcached://")
+	if addr == "" {
+		return nil, fmt.Errorf("memcached dsn must contain at least one address")
+	}
+
+	return &MemcachedStore{
+		client: memcache.New(strings.Split(addr, ",")...),
+		index:  make(map[string]struct{}),
+	}, nil
+}
+
+func (store *MemcachedStore) track(key string) {
+	store.mu.Lock()
+	store.index[key] = struct{}{}
+	store.mu.Unlock()
+}
+
+func (store *MemcachedStore) untrack(key string) {
+	store.mu.Lock()
+	delete(store.index, key)
+	store.mu.Unlock()
+}
+
+// Set stores value under key. TTL is passed straight through as Memcached's
+// own expiration field. value's type must have been passed to RegisterType
+// beforehand.
+func (store *MemcachedStore) Set(key string, value any, ttl int) error {
+	raw, err := encodeWireValue(value)
+	if err != nil {
+		return fmt.Errorf("failed to encode cache value: %s", err)
+	}
+
+	if err := store.client.Set(&memcache.Item{Key: key, Value: raw, Expiration: int32(ttl)}); err != nil {
+		return err
+	}
+
+	store.track(key)
+	return nil
+}
+
+func (store *MemcachedStore) Get(key string) (any, bool) {
+	item, err := store.client.Get(key)
+	if err != nil {
+		return nil, false
+	}
+
+	value, err := decodeWireValue(item.Value)
+	if err != nil {
+		return nil, false
+	}
+
+	return value, true
+}
+
+func (store *MemcachedStore) Gets(keys []string, prefix string) (map[string]any, []string) {
+	res := make(map[string]any)
+	notFound := make([]string, 0, len(keys))
+
+	prefixed := make([]string, len(keys))
+	lookup := make(map[string]string, len(keys))
+	for i, key := range keys {
+		prefixed[i] = prefix + key
+		lookup[prefix+key] = key
+	}
+
+	items, err := store.client.GetMulti(prefixed)
+	if err != nil {
+		return res, keys
+	}
+
+	for _, full := range prefixed {
+		item, ok := items[full]
+		if !ok {
+			notFound = append(notFound, lookup[full])
+			continue
+		}
+
+		value, err := decodeWireValue(item.Value)
+		if err != nil {
+			notFound = append(notFound, lookup[full])
+			continue
+		}
+
+		res[lookup[full]] = value
+	}
+
+	return res, notFound
+}
+
+func (store *MemcachedStore) Sets(values map[string]any, prefix string) error {
+	for key, value := range values {
+		raw, err := encodeWireValue(value)
+		if err != nil {
+			return fmt.Errorf("failed to encode cache value: %s", err)
+		}
+
+		full := prefix + key
+		if err := store.client.Set(&memcache.Item{Key: full, Value: raw}); err != nil {
+			return err
+		}
+
+		store.track(full)
+	}
+
+	return nil
+}
+
+// Delete removes the given keys under prefix. If no keys are given, it
+// removes every previously tracked key starting with prefix.
+func (store *MemcachedStore) Delete(prefix string, keys ...string) error {
+	if len(keys) > 0 {
+		for _, key := range keys {
+			full := prefix + key
+			if err := store.client.Delete(full); err != nil && err != memcache.ErrCacheMiss {
+				return err
+			}
+			store.untrack(full)
+		}
+		return nil
+	}
+
+	for _, key := range store.keysWithPrefix(prefix) {
+		if err := store.client.Delete(key); err != nil && err != memcache.ErrCacheMiss {
+			return err
+		}
+		store.untrack(key)
+	}
+
+	return nil
+}
+
+func (store *MemcachedStore) keysWithPrefix(prefix string) []string {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	keys := make([]string, 0, len(store.index))
+	for key := range store.index {
+		if strings.HasPrefix(key, prefix) {
+			keys = append(keys, key)
+		}
+	}
+	return keys
+}
+
+func (store *MemcachedStore) DeleteAll() error {
+	store.mu.Lock()
+	store.index = make(map[string]struct{})
+	store.mu.Unlock()
+
+	return store.client.FlushAll()
+}
+
+// List returns the previously tracked keys starting with prefix. See the
+// MemcachedStore doc comment: this can only see keys written through this
+// process, since the wire protocol has no native key-scan operation.
+func (store *MemcachedStore) List(prefix string) ([]string, error) {
+	var keys []string
+	err := store.Iterate(prefix, func(key string, value any) bool {
+		keys = append(keys, key)
+		return true
+	})
+	return keys, err
+}
+
+// Iterate calls fn for every previously tracked, still-present key starting
+// with prefix, until fn returns false. Best-effort, see List.
+func (store *MemcachedStore) Iterate(prefix string, fn func(key string, value any) bool) error {
+	for _, key := range store.keysWithPrefix(prefix) {
+		item, err := store.client.Get(key)
+		if err != nil {
+			store.untrack(key)
+			continue
+		}
+
+		value, err := decodeWireValue(item.Value)
+		if err != nil {
+			continue
+		}
+
+		if !fn(key, value) {
+			return nil
+		}
+	}
+
+	return nil
+}
+
+// Persist is a no-op for MemcachedStore: Memcached holds no durable state
+// for Cloudreve to snapshot.
+func (store *MemcachedStore) Persist(path string) error {
+	return nil
+}
+
+// Restore is a no-op for MemcachedStore, see Persist.
+func (store *MemcachedStore) Restore(path string) error {
+	return nil
+}
+
+// GarbageCollect is a no-op for MemcachedStore: expired keys are reclaimed
+// by Memcached itself via the TTL passed to Set.
+func (store *MemcachedStore) GarbageCollect(l logging.Logger) {}
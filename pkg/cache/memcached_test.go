@@ -0,0 +1,43 @@
+package cache
+
+import (
+	"sort"
+	"testing"
+)
+
+func TestNewMemcachedStore_RequiresAddress(t *testing.T) {
+	if _, err := NewMemcachedStore("memcached://"); err == nil {
+		t.Error("expected an error when no address is given")
+	}
+}
+
+func TestNewMemcachedStore_ParsesAddresses(t *testing.T) {
+	store, err := NewMemcachedStore("memcached://127.0.0.1:11211,127.0.0.1:11212")
+	if err != nil {
+		t.Fatalf("NewMemcachedStore returned error: %s", err)
+	}
+	if store.client == nil {
+		t.Error("expected a non-nil memcached client")
+	}
+}
+
+func TestMemcachedStore_KeysWithPrefix(t *testing.T) {
+	store := &MemcachedStore{index: make(map[string]struct{})}
+
+	store.track("ns:a")
+	store.track("ns:b")
+	store.track("other:c")
+
+	got := store.keysWithPrefix("ns:")
+	sort.Strings(got)
+	want := []string{"ns:a", "ns:b"}
+	if len(got) != len(want) || got[0] != want[0] || got[1] != want[1] {
+		t.Errorf("got %v, want %v", got, want)
+	}
+
+	store.untrack("ns:a")
+	got = store.keysWithPrefix("ns:")
+	if len(got) != 1 || got[0] != "ns:b" {
+		t.Errorf("got %v after untrack, want [ns:b]", got)
+	}
+}
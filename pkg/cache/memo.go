@@ -1,9 +1,12 @@
 package cache
 
 import (
-	"encoding/gob"
+	"container/list"
+	"context"
 	"fmt"
 	"os"
+	"reflect"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
@@ -12,66 +15,223 @@ import (
 	"github.com/cloudreve/Cloudreve/v4/pkg/util"
 )
 
+// defaultGCInterval is used when NewMemoStore is not given WithGCInterval.
+const defaultGCInterval = 10 * time.Minute
+
+var _ Driver = (*MemoStore)(nil)
+
 // MemoStore 内存存储驱动
+//
+// Entries are kept in a doubly-linked list ordered by recency plus a
+// key->element index, so that once MaxEntries or MaxMemory is exceeded the
+// least-recently-used entries can be evicted in O(1) without waiting for a
+// TTL miss or an explicit GarbageCollect.
 type MemoStore struct {
-	Store *sync.Map
+	mu         sync.Mutex
+	ll         *list.List
+	items      map[string]*list.Element
+	usedMemory int64
+
+	maxEntries int
+	maxMemory  int64
+
+	persistFile string
+	gcInterval  time.Duration
+	ctx         context.Context
+	cancel      context.CancelFunc
 }
 
-// item 存储的对象
-type itemWithTTL struct {
-	Expires int64
-	Value   interface{}
+// element is the value held by each *list.Element in MemoStore.ll.
+type element struct {
+	key     string
+	value   any
+	expires int64
+	size    int64
 }
 
 const DefaultCacheFile = "cache_persist.bin"
 
-func newItem(value interface{}, expires int) itemWithTTL {
-	expires64 := int64(expires)
-	if expires > 0 {
-		expires64 = time.Now().Unix() + expires64
+// Option configures optional behavior of a MemoStore, set via NewMemoStore.
+type Option func(*MemoStore)
+
+// WithMaxEntries caps the number of entries MemoStore will hold; once
+// exceeded, the least-recently-used entries are evicted. Zero (the default)
+// means unbounded.
+func WithMaxEntries(n int) Option {
+	return func(store *MemoStore) {
+		store.maxEntries = n
 	}
-	return itemWithTTL{
-		Value:   value,
-		Expires: expires64,
+}
+
+// WithMaxMemory caps the estimated encoded size of MemoStore's content,
+// expressed as a human string such as "128MB" or "1GB". Zero/empty (the
+// default) means unbounded.
+func WithMaxMemory(s string) Option {
+	return func(store *MemoStore) {
+		store.maxMemory = parseByteSize(s)
 	}
 }
 
-// getValue 从itemWithTTL中取值
-func getValue(item any, ok bool) (any, bool) {
-	if !ok {
-		return nil, ok
+// WithGCInterval overrides how often the background GC loop started by
+// NewMemoStore sweeps for expired entries. Defaults to defaultGCInterval.
+func WithGCInterval(d time.Duration) Option {
+	return func(store *MemoStore) {
+		store.gcInterval = d
+	}
+}
+
+// WithContext ties the background GC loop's lifetime to ctx: canceling ctx
+// stops the loop the same way Close does, so a caller can drive cache
+// teardown off an existing context (e.g. the server's root context) instead
+// of only being able to stop it through Close/Shutdown. Defaults to
+// context.Background(), i.e. only Close/Shutdown can stop the loop.
+func WithContext(ctx context.Context) Option {
+	return func(store *MemoStore) {
+		store.ctx, store.cancel = context.WithCancel(ctx)
 	}
+}
 
-	var itemObj itemWithTTL
-	if itemObj, ok = item.(itemWithTTL); !ok {
-		return item, true
+// parseByteSize parses strings like "128MB", "1GB", "512kb" into a byte
+// count. An empty or unrecognized string yields 0 (no limit).
+func parseByteSize(s string) int64 {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return 0
 	}
 
-	if itemObj.Expires > 0 && itemObj.Expires < time.Now().Unix() {
-		return nil, false
+	units := []struct {
+		suffix string
+		mul    int64
+	}{
+		{"GB", 1 << 30},
+		{"MB", 1 << 20},
+		{"KB", 1 << 10},
+		{"B", 1},
 	}
 
-	return itemObj.Value, ok
+	upper := strings.ToUpper(s)
+	for _, u := range units {
+		if strings.HasSuffix(upper, u.suffix) {
+			numeric := strings.TrimSpace(upper[:len(upper)-len(u.suffix)])
+			n, err := strconv.ParseFloat(numeric, 64)
+			if err != nil {
+				return 0
+			}
+			return int64(n * float64(u.mul))
+		}
+	}
 
+	n, err := strconv.ParseInt(upper, 10, 64)
+	if err != nil {
+		return 0
+	}
+	return n
+}
+
+// estimateSize gives a rough estimate, in bytes, of how much space value
+// takes up once cached. It walks the concrete value with reflection so a
+// struct/slice/map/pointer payload is sized by its actual contents, not by
+// unsafe.Sizeof(value) - which, since value's static type here is the `any`
+// interface, would always yield the fixed size of an interface header
+// regardless of what's stored in it. Good enough to compare against
+// MaxMemory, not an exact accounting.
+func estimateSize(value any) int64 {
+	if value == nil {
+		return 0
+	}
+	return int64(reflectSize(reflect.ValueOf(value), make(map[uintptr]bool)))
+}
+
+// reflectSize adds up a reflect.Value's fixed-size header plus the variable
+// portion of any string/slice/map/pointer it contains. seen guards against
+// cycles through pointers we've already visited.
+func reflectSize(v reflect.Value, seen map[uintptr]bool) uintptr {
+	switch v.Kind() {
+	case reflect.String:
+		return v.Type().Size() + uintptr(v.Len())
+	case reflect.Slice, reflect.Array:
+		size := v.Type().Size()
+		for i := 0; i < v.Len(); i++ {
+			size += reflectSize(v.Index(i), seen)
+		}
+		return size
+	case reflect.Map:
+		size := v.Type().Size()
+		for _, key := range v.MapKeys() {
+			size += reflectSize(key, seen) + reflectSize(v.MapIndex(key), seen)
+		}
+		return size
+	case reflect.Ptr:
+		if v.IsNil() {
+			return v.Type().Size()
+		}
+		ptr := v.Pointer()
+		if seen[ptr] {
+			return v.Type().Size()
+		}
+		seen[ptr] = true
+		return v.Type().Size() + reflectSize(v.Elem(), seen)
+	case reflect.Interface:
+		if v.IsNil() {
+			return v.Type().Size()
+		}
+		return v.Type().Size() + reflectSize(v.Elem(), seen)
+	case reflect.Struct:
+		size := v.Type().Size()
+		for i := 0; i < v.NumField(); i++ {
+			f := v.Field(i)
+			switch f.Kind() {
+			case reflect.String, reflect.Slice, reflect.Map, reflect.Ptr, reflect.Interface:
+				// f's fixed-size header is already counted in the struct's
+				// own Size(); only add the variable portion on top of it.
+				size += reflectSize(f, seen) - f.Type().Size()
+			}
+		}
+		return size
+	default:
+		return v.Type().Size()
+	}
+}
+
+func expiresAt(ttl int) int64 {
+	if ttl <= 0 {
+		return 0
+	}
+	return time.Now().Unix() + int64(ttl)
+}
+
+func isExpired(expires int64) bool {
+	return expires > 0 && expires < time.Now().Unix()
 }
 
 // GarbageCollect 回收已过期的缓存
 func (store *MemoStore) GarbageCollect(l logging.Logger) {
-	store.Store.Range(func(key, value any) bool {
-		if item, ok := value.(itemWithTTL); ok {
-			if item.Expires > 0 && item.Expires < time.Now().Unix() {
-				l.Debug("Cache %q is garbage collected.", key.(string))
-				store.Store.Delete(key)
-			}
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	for e := store.ll.Front(); e != nil; {
+		next := e.Next()
+		el := e.Value.(*element)
+		if isExpired(el.expires) {
+			l.Debug("Cache %q is garbage collected.", el.key)
+			store.removeElement(e)
 		}
-		return true
-	})
+		e = next
+	}
 }
 
 // NewMemoStore 新建内存存储
-func NewMemoStore(persistFile string, l logging.Logger) *MemoStore {
+func NewMemoStore(persistFile string, l logging.Logger, options ...Option) *MemoStore {
 	store := &MemoStore{
-		Store: &sync.Map{},
+		ll:          list.New(),
+		items:       make(map[string]*list.Element),
+		persistFile: persistFile,
+		gcInterval:  defaultGCInterval,
+	}
+	store.ctx, store.cancel = context.WithCancel(context.Background())
+
+	for _, o := range options {
+		o(store)
 	}
 
 	if persistFile != "" {
@@ -80,18 +240,127 @@ func NewMemoStore(persistFile string, l logging.Logger) *MemoStore {
 		}
 	}
 
+	go store.gcLoop(l)
+
 	return store
 }
 
+// gcLoop periodically sweeps expired entries until store.ctx is canceled,
+// whether that's by Close, Shutdown, or the caller-supplied context passed
+// via WithContext being canceled.
+func (store *MemoStore) gcLoop(l logging.Logger) {
+	ticker := time.NewTicker(store.gcInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			store.GarbageCollect(l)
+		case <-store.ctx.Done():
+			return
+		}
+	}
+}
+
+// Close stops the background GC loop without persisting the current cache
+// state. Safe to call more than once.
+func (store *MemoStore) Close() error {
+	store.cancel()
+	return nil
+}
+
+// Shutdown stops the background GC loop and, if a persist file was
+// configured via NewMemoStore, flushes the current cache content to it. It
+// honors ctx cancellation so callers can bound how long they wait for that
+// final Persist to complete.
+func (store *MemoStore) Shutdown(ctx context.Context) error {
+	store.Close()
+
+	if store.persistFile == "" {
+		return nil
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		done <- store.Persist(store.persistFile)
+	}()
+
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
 // Set 存储值
 func (store *MemoStore) Set(key string, value any, ttl int) error {
-	store.Store.Store(key, newItem(value, ttl))
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	store.setLocked(key, value, expiresAt(ttl))
 	return nil
 }
 
+// setLocked inserts or updates key at the front of the LRU list and evicts
+// from the back until the store is back under its configured limits. It
+// must be called with store.mu held.
+func (store *MemoStore) setLocked(key string, value any, expires int64) {
+	size := estimateSize(value)
+
+	if e, ok := store.items[key]; ok {
+		old := e.Value.(*element)
+		store.usedMemory += size - old.size
+		old.value, old.expires, old.size = value, expires, size
+		store.ll.MoveToFront(e)
+	} else {
+		e := store.ll.PushFront(&element{key: key, value: value, expires: expires, size: size})
+		store.items[key] = e
+		store.usedMemory += size
+	}
+
+	store.evictLocked()
+}
+
+// evictLocked removes least-recently-used entries until the store satisfies
+// maxEntries/maxMemory. It must be called with store.mu held.
+func (store *MemoStore) evictLocked() {
+	for (store.maxEntries > 0 && store.ll.Len() > store.maxEntries) ||
+		(store.maxMemory > 0 && store.usedMemory > store.maxMemory) {
+		back := store.ll.Back()
+		if back == nil {
+			return
+		}
+		store.removeElement(back)
+	}
+}
+
+// removeElement unlinks e from the list and index, adjusting usedMemory. It
+// must be called with store.mu held.
+func (store *MemoStore) removeElement(e *list.Element) {
+	el := e.Value.(*element)
+	store.ll.Remove(e)
+	delete(store.items, el.key)
+	store.usedMemory -= el.size
+}
+
 // Get 取值
 func (store *MemoStore) Get(key string) (any, bool) {
-	return getValue(store.Store.Load(key))
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	e, ok := store.items[key]
+	if !ok {
+		return nil, false
+	}
+
+	el := e.Value.(*element)
+	if isExpired(el.expires) {
+		return nil, false
+	}
+
+	store.ll.MoveToFront(e)
+	return el.value, true
 }
 
 // Gets 批量取值
@@ -100,7 +369,7 @@ func (store *MemoStore) Gets(keys []string, prefix string) (map[string]any, []st
 	var notFound = make([]string, 0, len(keys))
 
 	for _, key := range keys {
-		if value, ok := getValue(store.Store.Load(prefix + key)); ok {
+		if value, ok := store.Get(prefix + key); ok {
 			res[key] = value
 		} else {
 			notFound = append(notFound, key)
@@ -112,49 +381,96 @@ func (store *MemoStore) Gets(keys []string, prefix string) (map[string]any, []st
 
 // Sets 批量设置值
 func (store *MemoStore) Sets(values map[string]any, prefix string) error {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
 	for key, value := range values {
-		store.Store.Store(prefix+key, newItem(value, 0))
+		store.setLocked(prefix+key, value, 0)
 	}
 	return nil
 }
 
 // Delete 批量删除值
 func (store *MemoStore) Delete(prefix string, keys ...string) error {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
 	for _, key := range keys {
-		store.Store.Delete(prefix + key)
+		if e, ok := store.items[prefix+key]; ok {
+			store.removeElement(e)
+		}
 	}
 
 	// No key is presented, delete all entries with given prefix.
 	if len(keys) == 0 {
-		store.Store.Range(func(key, value any) bool {
-			if k, ok := key.(string); ok && strings.HasPrefix(k, prefix) {
-				store.Store.Delete(key)
+		for e := store.ll.Front(); e != nil; {
+			next := e.Next()
+			if strings.HasPrefix(e.Value.(*element).key, prefix) {
+				store.removeElement(e)
 			}
-			return true
-		})
+			e = next
+		}
 	}
 	return nil
 }
 
-// Persist write memory store into cache
+// List returns the non-expired keys whose key starts with prefix.
+func (store *MemoStore) List(prefix string) ([]string, error) {
+	var keys []string
+	err := store.Iterate(prefix, func(key string, value any) bool {
+		keys = append(keys, key)
+		return true
+	})
+	return keys, err
+}
+
+// Iterate calls fn for every non-expired entry whose key starts with
+// prefix, walking the LRU list from most- to least-recently-used, until fn
+// returns false.
+func (store *MemoStore) Iterate(prefix string, fn func(key string, value any) bool) error {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	for e := store.ll.Front(); e != nil; e = e.Next() {
+		el := e.Value.(*element)
+		if !strings.HasPrefix(el.key, prefix) || isExpired(el.expires) {
+			continue
+		}
+		if !fn(el.key, el.value) {
+			break
+		}
+	}
+
+	return nil
+}
+
+// Persist write memory store into cache, using the versioned msgpack format
+// described in persist.go.
 func (store *MemoStore) Persist(path string) error {
-	persisted := make(map[string]itemWithTTL)
-	store.Store.Range(func(key, value any) bool {
-		v, ok := store.Store.Load(key)
-		if _, ok := getValue(v, ok); ok {
-			persisted[key.(string)] = v.(itemWithTTL)
+	store.mu.Lock()
+	// Walk front-to-back (most- to least-recently-used) so Restore can
+	// re-insert in the same relative order.
+	entries := make([]persistEntry, 0, store.ll.Len())
+	for e := store.ll.Front(); e != nil; e = e.Next() {
+		el := e.Value.(*element)
+		if isExpired(el.expires) {
+			continue
 		}
 
-		return true
-	})
+		typeTag, payload, err := encodeEntryValue(el.value)
+		if err != nil {
+			// Skip and keep going instead of aborting the whole Persist -
+			// one entry whose type was never passed to RegisterType
+			// shouldn't cost every other entry its persistence too.
+			util.Log().Warning("Skipping cache entry %q while persisting: %s", el.key, err)
+			continue
+		}
 
-	res, err := serializer(persisted)
-	if err != nil {
-		return fmt.Errorf("failed to serialize cache: %s", err)
+		entries = append(entries, persistEntry{Key: el.key, Expires: el.expires, TypeTag: typeTag, Payload: payload})
 	}
+	store.mu.Unlock()
 
-	err = os.WriteFile(path, res, 0644)
-	return err
+	return writePersistFile(path, entries)
 }
 
 // Restore memory cache from disk file
@@ -163,31 +479,34 @@ func (store *MemoStore) Restore(path string) error {
 		return nil
 	}
 
-	f, err := os.Open(path)
+	entries, err := readPersistFile(path)
+	os.Remove(path)
 	if err != nil {
-		return fmt.Errorf("failed to read cache file: %s", err)
-	}
-
-	defer func() {
-		f.Close()
-		os.Remove(path)
-	}()
-
-	persisted := &item{}
-	dec := gob.NewDecoder(f)
-	if err := dec.Decode(&persisted); err != nil {
 		return fmt.Errorf("unknown cache file format: %s", err)
 	}
 
-	items := persisted.Value.(map[string]itemWithTTL)
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	// Insert from least- to most-recently-used, so the most-recently-used
+	// entries end up at the front again - and are the last to be evicted if
+	// MaxEntries/MaxMemory is hit partway through.
 	loaded := 0
-	for k, v := range items {
-		if _, ok := getValue(v, true); ok {
-			loaded++
-			store.Store.Store(k, v)
-		} else {
-			util.Log().Debug("Persisted cache %q is expired.", k)
+	for i := len(entries) - 1; i >= 0; i-- {
+		entry := entries[i]
+		if isExpired(entry.Expires) {
+			util.Log().Debug("Persisted cache %q is expired.", entry.Key)
+			continue
+		}
+
+		value, ok := decodeEntryValue(entry.TypeTag, entry.Payload)
+		if !ok {
+			util.Log().Warning("Skipping persisted cache %q: unregistered type %q.", entry.Key, entry.TypeTag)
+			continue
 		}
+
+		loaded++
+		store.setLocked(entry.Key, value, entry.Expires)
 	}
 
 	util.Log().Info("Restored %d items from %q into memory cache.", loaded, path)
@@ -195,10 +514,11 @@ func (store *MemoStore) Restore(path string) error {
 }
 
 func (store *MemoStore) DeleteAll() error {
-	store.Store.Range(func(key any, value any) bool {
-		store.Store.Delete(key)
-		return true
-	})
+	store.mu.Lock()
+	defer store.mu.Unlock()
 
+	store.ll.Init()
+	store.items = make(map[string]*list.Element)
+	store.usedMemory = 0
 	return nil
 }
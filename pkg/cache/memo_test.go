@@ -0,0 +1,72 @@
+package cache
+
+import (
+	"testing"
+)
+
+// testLogger is a minimal logging.Logger stand-in for tests that never
+// assert on log output.
+type testLogger struct{}
+
+func (testLogger) Debug(format string, v ...any)   {}
+func (testLogger) Info(format string, v ...any)    {}
+func (testLogger) Warning(format string, v ...any) {}
+func (testLogger) Error(format string, v ...any)   {}
+
+func TestMemoStore_MaxEntriesEviction(t *testing.T) {
+	store := NewMemoStore("", testLogger{}, WithMaxEntries(2))
+	defer store.Close()
+
+	store.Set("a", "1", 0)
+	store.Set("b", "2", 0)
+	store.Set("c", "3", 0)
+
+	if _, ok := store.Get("a"); ok {
+		t.Error("expected least-recently-used key \"a\" to have been evicted")
+	}
+	if _, ok := store.Get("b"); !ok {
+		t.Error("expected key \"b\" to still be present")
+	}
+	if _, ok := store.Get("c"); !ok {
+		t.Error("expected key \"c\" to still be present")
+	}
+}
+
+func TestMemoStore_GetRefreshesRecency(t *testing.T) {
+	store := NewMemoStore("", testLogger{}, WithMaxEntries(2))
+	defer store.Close()
+
+	store.Set("a", "1", 0)
+	store.Set("b", "2", 0)
+
+	// Touch "a" so "b" becomes the least-recently-used entry.
+	store.Get("a")
+	store.Set("c", "3", 0)
+
+	if _, ok := store.Get("b"); ok {
+		t.Error("expected \"b\" to have been evicted after \"a\" was refreshed by Get")
+	}
+	if _, ok := store.Get("a"); !ok {
+		t.Error("expected \"a\" to survive eviction after being refreshed")
+	}
+}
+
+func TestMemoStore_MaxMemoryEviction(t *testing.T) {
+	// Each entry here is a 64-byte string; cap the store at roughly 2
+	// entries worth of memory and confirm it doesn't grow past that.
+	store := NewMemoStore("", testLogger{}, WithMaxMemory("150B"))
+	defer store.Close()
+
+	payload := make([]byte, 64)
+	for i := 0; i < 10; i++ {
+		store.Set(string(rune('a'+i)), string(payload), 0)
+	}
+
+	keys, err := store.List("")
+	if err != nil {
+		t.Fatalf("List returned error: %s", err)
+	}
+	if len(keys) >= 10 {
+		t.Errorf("expected MaxMemory to bound the number of retained entries, got %d", len(keys))
+	}
+}
@@ -0,0 +1,287 @@
+package cache
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"encoding/gob"
+	"fmt"
+	"io"
+	"os"
+	"reflect"
+	"sync"
+	"time"
+
+	"github.com/ugorji/go/codec"
+)
+
+// persistMagic/persistVersion identify the on-disk cache file format. A
+// version bump here means readers older than this code will refuse the
+// file outright instead of misinterpreting it.
+const (
+	persistMagic   uint32 = 0x43524346 // "CRCF"
+	persistVersion uint32 = 1
+)
+
+// persistHeader is written once at the start of a persisted cache file,
+// immediately followed by EntryCount length-prefixed, msgpack-encoded
+// persistEntry records.
+type persistHeader struct {
+	Magic      uint32
+	Version    uint32
+	CreatedAt  int64
+	EntryCount uint64
+}
+
+// persistEntry is the on-disk representation of a single cache item.
+// Payload is the msgpack encoding of the cached value under its own type,
+// tagged with TypeTag so Restore can reconstruct it without depending on
+// the value's Go type definition being byte-for-byte unchanged across
+// releases - only its registered name has to still resolve, see
+// RegisterType.
+type persistEntry struct {
+	Key     string `codec:"key"`
+	Expires int64  `codec:"expires"`
+	TypeTag string `codec:"type"`
+	Payload []byte `codec:"payload"`
+}
+
+var msgpackHandle = &codec.MsgpackHandle{}
+
+var (
+	typeRegistryMu sync.RWMutex
+	typesByName    = map[string]any{}
+	namesByType    = map[reflect.Type]string{}
+)
+
+// RegisterType associates a stable, version-independent name with a Go type
+// so that values of that type can be safely round-tripped through a
+// persisted cache file across releases that may have renamed or moved the
+// type. Call this from an init() func in the package that owns the cached
+// type, before any MemoStore is restored from disk.
+func RegisterType(name string, zero any) {
+	typeRegistryMu.Lock()
+	defer typeRegistryMu.Unlock()
+
+	typesByName[name] = zero
+	namesByType[reflect.TypeOf(zero)] = name
+}
+
+// init seeds the registry with the common builtin kinds callers store in the
+// cache without a second thought - plain strings, numbers, booleans, raw
+// bytes, timestamps. encoding/gob, which this registry replaces, registers
+// exactly these primitives for free; without this, every cache.Set("k",
+// "v", 0) anywhere in the codebase would fail to persist or go over the
+// wire until its caller remembered to call RegisterType by hand.
+func init() {
+	RegisterType("builtin.string", "")
+	RegisterType("builtin.bool", false)
+	RegisterType("builtin.int", int(0))
+	RegisterType("builtin.int8", int8(0))
+	RegisterType("builtin.int16", int16(0))
+	RegisterType("builtin.int32", int32(0))
+	RegisterType("builtin.int64", int64(0))
+	RegisterType("builtin.uint", uint(0))
+	RegisterType("builtin.uint8", uint8(0))
+	RegisterType("builtin.uint16", uint16(0))
+	RegisterType("builtin.uint32", uint32(0))
+	RegisterType("builtin.uint64", uint64(0))
+	RegisterType("builtin.float32", float32(0))
+	RegisterType("builtin.float64", float64(0))
+	RegisterType("builtin.bytes", []byte(nil))
+	RegisterType("builtin.time.Time", time.Time{})
+}
+
+// encodeEntryValue looks up value's registered type tag and msgpack-encodes
+// it into a persistEntry payload.
+func encodeEntryValue(value any) (typeTag string, payload []byte, err error) {
+	typeRegistryMu.RLock()
+	typeTag, ok := namesByType[reflect.TypeOf(value)]
+	typeRegistryMu.RUnlock()
+	if !ok {
+		return "", nil, fmt.Errorf("type %T is not registered, call cache.RegisterType first", value)
+	}
+
+	var buf bytes.Buffer
+	if err := codec.NewEncoder(&buf, msgpackHandle).Encode(value); err != nil {
+		return "", nil, err
+	}
+
+	return typeTag, buf.Bytes(), nil
+}
+
+// decodeEntryValue reverses encodeEntryValue. ok is false if typeTag is not
+// registered, in which case the entry should be skipped rather than
+// aborting the whole restore.
+func decodeEntryValue(typeTag string, payload []byte) (value any, ok bool) {
+	typeRegistryMu.RLock()
+	zero, ok := typesByName[typeTag]
+	typeRegistryMu.RUnlock()
+	if !ok {
+		return nil, false
+	}
+
+	target := reflect.New(reflect.TypeOf(zero)).Interface()
+	if err := codec.NewDecoderBytes(payload, msgpackHandle).Decode(target); err != nil {
+		return nil, false
+	}
+
+	return reflect.ValueOf(target).Elem().Interface(), true
+}
+
+// writePersistFile atomically writes entries to path: it is written in full
+// to a temp file first, then renamed into place, so a crash mid-write can't
+// truncate the previous good snapshot.
+func writePersistFile(path string, entries []persistEntry) (err error) {
+	tmp := path + ".tmp"
+	f, err := os.Create(tmp)
+	if err != nil {
+		return fmt.Errorf("failed to create temp cache file: %s", err)
+	}
+
+	defer func() {
+		f.Close()
+		if err != nil {
+			os.Remove(tmp)
+		}
+	}()
+
+	w := bufio.NewWriter(f)
+	header := persistHeader{
+		Magic:      persistMagic,
+		Version:    persistVersion,
+		CreatedAt:  time.Now().Unix(),
+		EntryCount: uint64(len(entries)),
+	}
+
+	if err = binary.Write(w, binary.BigEndian, header); err != nil {
+		return fmt.Errorf("failed to write cache file header: %s", err)
+	}
+
+	for _, entry := range entries {
+		var raw []byte
+		raw, err = encodePersistEntry(entry)
+		if err != nil {
+			return fmt.Errorf("failed to encode cache entry: %s", err)
+		}
+
+		if err = binary.Write(w, binary.BigEndian, uint32(len(raw))); err != nil {
+			return err
+		}
+		if _, err = w.Write(raw); err != nil {
+			return err
+		}
+	}
+
+	if err = w.Flush(); err != nil {
+		return fmt.Errorf("failed to flush cache file: %s", err)
+	}
+	if err = f.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp, path)
+}
+
+// readPersistFile reads back a file written by writePersistFile.
+func readPersistFile(path string) ([]persistEntry, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	r := bufio.NewReader(f)
+	var header persistHeader
+	if err := binary.Read(r, binary.BigEndian, &header); err != nil {
+		return nil, fmt.Errorf("failed to read cache file header: %s", err)
+	}
+
+	if header.Magic != persistMagic {
+		return nil, fmt.Errorf("bad cache file magic %x", header.Magic)
+	}
+	if header.Version != persistVersion {
+		return nil, fmt.Errorf("unsupported cache file version %d", header.Version)
+	}
+
+	entries := make([]persistEntry, 0, header.EntryCount)
+	for i := uint64(0); i < header.EntryCount; i++ {
+		var size uint32
+		if err := binary.Read(r, binary.BigEndian, &size); err != nil {
+			return nil, fmt.Errorf("failed to read cache entry length: %s", err)
+		}
+
+		raw := make([]byte, size)
+		if _, err := io.ReadFull(r, raw); err != nil {
+			return nil, fmt.Errorf("failed to read cache entry: %s", err)
+		}
+
+		entry, err := decodePersistEntry(raw)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode cache entry: %s", err)
+		}
+
+		entries = append(entries, entry)
+	}
+
+	return entries, nil
+}
+
+func encodePersistEntry(entry persistEntry) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := codec.NewEncoder(&buf, msgpackHandle).Encode(entry); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func decodePersistEntry(raw []byte) (persistEntry, error) {
+	var entry persistEntry
+	err := codec.NewDecoderBytes(raw, msgpackHandle).Decode(&entry)
+	return entry, err
+}
+
+// legacyItemWithTTL mirrors the pre-msgpack MemoStore's on-disk item shape:
+// a gob-encoded map[string]legacyItemWithTTL, keyed by cache key. This is
+// the format real installs actually have on disk, not persistEntry - see
+// MigrateLegacyCacheFile.
+type legacyItemWithTTL struct {
+	Expires int64
+	Value   any
+}
+
+// MigrateLegacyCacheFile reads a cache file written by the old
+// encoding/gob-based Persist and rewrites it in place using the current
+// versioned msgpack format. No command-line flag in this package invokes it;
+// it runs only when called directly. Values whose type was never registered
+// via RegisterType are dropped rather than aborting the whole migration.
+func MigrateLegacyCacheFile(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("failed to open legacy cache file: %s", err)
+	}
+
+	var legacy map[string]legacyItemWithTTL
+	err = gob.NewDecoder(f).Decode(&legacy)
+	f.Close()
+	if err != nil {
+		return fmt.Errorf("failed to decode legacy cache file: %s", err)
+	}
+
+	entries := make([]persistEntry, 0, len(legacy))
+	for key, item := range legacy {
+		typeTag, payload, err := encodeEntryValue(item.Value)
+		if err != nil {
+			continue
+		}
+
+		entries = append(entries, persistEntry{
+			Key:     key,
+			Expires: item.Expires,
+			TypeTag: typeTag,
+			Payload: payload,
+		})
+	}
+
+	return writePersistFile(path, entries)
+}
@@ -0,0 +1,102 @@
+package cache
+
+import (
+	"bytes"
+	"encoding/gob"
+	"os"
+	"testing"
+)
+
+type testPersistValue struct {
+	Name  string
+	Count int
+}
+
+func init() {
+	RegisterType("cache.testPersistValue", testPersistValue{})
+}
+
+func TestMemoStore_PersistRestoreRoundTrip(t *testing.T) {
+	path := t.TempDir() + "/cache.bin"
+
+	store := NewMemoStore("", testLogger{})
+	defer store.Close()
+
+	store.Set("a", testPersistValue{Name: "a", Count: 1}, 0)
+	store.Set("b", testPersistValue{Name: "b", Count: 2}, 0)
+
+	if err := store.Persist(path); err != nil {
+		t.Fatalf("Persist returned error: %s", err)
+	}
+
+	restored := NewMemoStore(path, testLogger{})
+	defer restored.Close()
+
+	value, ok := restored.Get("a")
+	if !ok {
+		t.Fatal("expected key \"a\" to be restored")
+	}
+	if got := value.(testPersistValue); got != (testPersistValue{Name: "a", Count: 1}) {
+		t.Errorf("got %+v, want {a 1}", got)
+	}
+
+	if _, ok := restored.Get("b"); !ok {
+		t.Fatal("expected key \"b\" to be restored")
+	}
+}
+
+func TestMemoStore_PersistSkipsUnregisteredType(t *testing.T) {
+	path := t.TempDir() + "/cache.bin"
+
+	store := NewMemoStore("", testLogger{})
+	defer store.Close()
+
+	store.Set("known", testPersistValue{Name: "known", Count: 1}, 0)
+	store.Set("unknown", struct{ X int }{X: 1}, 0)
+
+	if err := store.Persist(path); err != nil {
+		t.Fatalf("Persist returned error: %s", err)
+	}
+
+	restored := NewMemoStore(path, testLogger{})
+	defer restored.Close()
+
+	if _, ok := restored.Get("known"); !ok {
+		t.Error("expected the registered-type entry to survive Persist despite the unregistered one")
+	}
+}
+
+func TestMigrateLegacyCacheFile(t *testing.T) {
+	path := t.TempDir() + "/legacy_cache.bin"
+
+	legacy := map[string]legacyItemWithTTL{
+		"a": {Expires: 0, Value: testPersistValue{Name: "a", Count: 1}},
+	}
+
+	// gob only encodes a value held in an interface field once its concrete
+	// type is registered, as the old gob-based Persist required too.
+	gob.Register(testPersistValue{})
+
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(legacy); err != nil {
+		t.Fatalf("failed to encode synthetic legacy cache file: %s", err)
+	}
+	if err := os.WriteFile(path, buf.Bytes(), 0644); err != nil {
+		t.Fatalf("failed to write synthetic legacy cache file: %s", err)
+	}
+
+	if err := MigrateLegacyCacheFile(path); err != nil {
+		t.Fatalf("MigrateLegacyCacheFile returned error: %s", err)
+	}
+
+	store := NewMemoStore(path, testLogger{})
+	defer store.Close()
+
+	value, ok := store.Get("a")
+	if !ok {
+		t.Fatal("expected key \"a\" to be restored from the migrated file")
+	}
+	if got := value.(testPersistValue); got != (testPersistValue{Name: "a", Count: 1}) {
+		t.Errorf("got %+v, want {a 1}", got)
+	}
+}
@@ -0,0 +1,19 @@
+package cache
+
+import "testing"
+
+func TestNewRedisStore_InvalidDSN(t *testing.T) {
+	if _, err := NewRedisStore("not a dsn"); err == nil {
+		t.Error("expected an error for a malformed redis dsn")
+	}
+}
+
+func TestNewRedisStore_ValidDSN(t *testing.T) {
+	store, err := NewRedisStore("redis://127.0.0.1:6379/0")
+	if err != nil {
+		t.Fatalf("NewRedisStore returned error: %s", err)
+	}
+	if store.client == nil {
+		t.Error("expected a non-nil redis client")
+	}
+}
@@ -0,0 +1,50 @@
+package cache
+
+import (
+	"bytes"
+	"fmt"
+
+	"github.com/ugorji/go/codec"
+)
+
+// wireValue is the envelope RedisStore/MemcachedStore use to serialize a
+// cached value over the wire. It reuses the same RegisterType registry as
+// disk persistence (see persist.go) instead of relying on the stdlib
+// encoding/gob's separate, easy-to-forget gob.Register mechanism - so a
+// value that round-trips through Persist/Restore also round-trips through a
+// network-backed Driver without a second registration step.
+type wireValue struct {
+	TypeTag string `codec:"type"`
+	Payload []byte `codec:"payload"`
+}
+
+// encodeWireValue serializes value for storage in Redis/Memcached. It
+// errors if value's type was never passed to RegisterType.
+func encodeWireValue(value any) ([]byte, error) {
+	typeTag, payload, err := encodeEntryValue(value)
+	if err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	if err := codec.NewEncoder(&buf, msgpackHandle).Encode(wireValue{TypeTag: typeTag, Payload: payload}); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+// decodeWireValue reverses encodeWireValue.
+func decodeWireValue(raw []byte) (any, error) {
+	var wv wireValue
+	if err := codec.NewDecoderBytes(raw, msgpackHandle).Decode(&wv); err != nil {
+		return nil, err
+	}
+
+	value, ok := decodeEntryValue(wv.TypeTag, wv.Payload)
+	if !ok {
+		return nil, fmt.Errorf("type %q is not registered, call cache.RegisterType first", wv.TypeTag)
+	}
+
+	return value, nil
+}
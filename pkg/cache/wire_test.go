@@ -0,0 +1,38 @@
+package cache
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestWireValueRoundTrip(t *testing.T) {
+	cases := []any{
+		"hello",
+		42,
+		true,
+		[]byte("raw bytes"),
+		testPersistValue{Name: "x", Count: 1},
+	}
+
+	for _, want := range cases {
+		raw, err := encodeWireValue(want)
+		if err != nil {
+			t.Fatalf("encodeWireValue(%#v) returned error: %s", want, err)
+		}
+
+		got, err := decodeWireValue(raw)
+		if err != nil {
+			t.Fatalf("decodeWireValue returned error: %s", err)
+		}
+
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("got %#v, want %#v", got, want)
+		}
+	}
+}
+
+func TestEncodeWireValue_UnregisteredType(t *testing.T) {
+	if _, err := encodeWireValue(struct{ X int }{X: 1}); err == nil {
+		t.Error("expected an error encoding a type never passed to RegisterType")
+	}
+}